@@ -17,18 +17,26 @@ limitations under the License.
 package main
 
 import (
-	// "context"
-	"errors"
-	"fmt"
-	"k8s.io/api/admission/v1beta1"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"log"
-	"net/http"
+	"crypto/tls"
+	"flag"
+	"os"
 	"path/filepath"
-	"strings"
+	"time"
+
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cosfirewallv1alpha1 "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/apis/cosfirewall/v1alpha1"
+	"github.com/Bhagyashreek8/ibm-cos-firewall-webhook/controllers/cosfirewall"
+	cosfirewallwebhook "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/webhook"
 )
 
 const (
@@ -37,172 +45,104 @@ const (
 	tlsKeyFile  = `tls.key`
 )
 
-var (
-	goClient *kubernetes.Clientset
-	podResource = metav1.GroupVersionResource{Version: "v1", Resource: "pods"}
-	pvResource = metav1.GroupVersionResource{Version: "v1", Resource: "persistentvolumes"}
-)
-
-// applyPODSecurity implements the logic of our example admission controller webhook. For every pod that is created
-// (outside of Kubernetes namespaces), it first checks if `runAsNonRoot` is set. If it is not, it is set to a default
-// value of `false`. Furthermore, if `runAsUser` is not set (and `runAsNonRoot` was not initially set), it defaults
-// `runAsUser` to a value of 1234.
-//
-// To demonstrate how requests can be rejected, this webhook further validates that the `runAsNonRoot` setting does
-// not conflict with the `runAsUser` setting - i.e., if the former is set to `true`, the latter must not be `0`.
-// Note that we combine both the setting of defaults and the check for potential conflicts in one webhook; ideally,
-// the latter would be performed in a validating webhook admission controller.
-func applyPODSecurity(req *v1beta1.AdmissionRequest) ([]patchOperation, error) {
-	log.Printf("--applyPODSecurity--")
-	// This handler should only get called on Pod objects as per the MutatingWebhookConfiguration in the YAML file.
-	// However, if (for whatever reason) this gets invoked on an object of a different kind, issue a log message but
-	// let the object request pass through otherwise.
-	if req.Resource != podResource {
-		log.Printf("expect resource to be %s", podResource)
-		return nil, nil
-	}
+var log = logf.Log.WithName("webhook-server")
 
-	// Parse the Pod object.
-	raw := req.Object.Raw
-	pod := corev1.Pod{}
-	if _, _, err := universalDeserializer.Decode(raw, nil, &pod); err != nil {
-		return nil, fmt.Errorf("could not deserialize pod object: %v", err)
+func main() {
+	var (
+		metricsAddr          string
+		probeAddr            string
+		webhookCertDir       string
+		enableLeaderElection bool
+		resyncPeriod         time.Duration
+	)
+	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", tlsDir, "Directory containing tls.crt/tls.key for the webhook server.")
+	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager.")
+	flag.DurationVar(&resyncPeriod, "firewall-resync-period", cosfirewall.DefaultResyncPeriod, "How often to recheck each bucket's firewall for drift, even absent a triggering event.")
+	opts := zap.Options{Development: true}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	logf.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	scheme := clientgoscheme.Scheme
+	if err := cosfirewallv1alpha1.AddToScheme(scheme); err != nil {
+		log.Error(err, "unable to add COSFirewallPolicy to scheme")
+		os.Exit(1)
 	}
 
-	// Retrieve the `runAsNonRoot` and `runAsUser` values.
-	var runAsNonRoot *bool
-	var runAsUser *int64
-	if pod.Spec.SecurityContext != nil {
-		runAsNonRoot = pod.Spec.SecurityContext.RunAsNonRoot
-		runAsUser = pod.Spec.SecurityContext.RunAsUser
+	// Certs are reloaded live via certwatcher/fsnotify rather than CertDir's
+	// own polling, so that cert-manager rotating tls.crt/tls.key no longer
+	// forces a pod restart.
+	certWatcher, err := certwatcher.New(
+		filepath.Join(webhookCertDir, tlsCertFile),
+		filepath.Join(webhookCertDir, tlsKeyFile),
+	)
+	if err != nil {
+		log.Error(err, "unable to set up cert watcher")
+		os.Exit(1)
 	}
 
-	// Create patch operations to apply sensible defaults, if those options are not set explicitly.
-	var patches []patchOperation
-	if runAsNonRoot == nil {
-		patches = append(patches, patchOperation{
-			Op:    "add",
-			Path:  "/spec/securityContext/runAsNonRoot",
-			// The value must not be true if runAsUser is set to 0, as otherwise we would create a conflicting
-			// configuration ourselves.
-			Value: runAsUser == nil || *runAsUser != 0,
-		})
-
-		if runAsUser == nil {
-			patches = append(patches, patchOperation{
-				Op:    "add",
-				Path:  "/spec/securityContext/runAsUser",
-				Value: 1234,
-			})
-		}
-	} else if *runAsNonRoot == true && (runAsUser != nil && *runAsUser == 0) {
-		// Make sure that the settings are not contradictory, and fail the object creation if they are.
-		return nil, errors.New("runAsNonRoot specified, but runAsUser set to 0 (the root user)")
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:  scheme,
+		Metrics: metricsserver.Options{BindAddress: metricsAddr},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port: 9443,
+			TLSOpts: []func(*tls.Config){
+				func(cfg *tls.Config) { cfg.GetCertificate = certWatcher.GetCertificate },
+			},
+		}),
+		HealthProbeBindAddress: probeAddr,
+		LeaderElection:         enableLeaderElection,
+		LeaderElectionID:       "ibm-cos-firewall-webhook-leader",
+	})
+	if err != nil {
+		log.Error(err, "unable to start manager")
+		os.Exit(1)
 	}
 
-	return patches, nil
-}
-
-func applyPVSecurity(req *v1beta1.AdmissionRequest) ([]patchOperation, error) {
-	log.Printf("--applyPVSecurity--")
-
-	var confFW bool = false
-	var bucketName, secretName, secretNameSpace string
-	var resConfApiKey, allowedIPs string
-
-	if req.Resource != pvResource {
-		log.Printf("expect resource to be %s", pvResource)
-		return nil, nil
+	if err := mgr.Add(certWatcher); err != nil {
+		log.Error(err, "unable to add cert watcher to manager")
+		os.Exit(1)
 	}
 
-	// Parse the Pod object.
-	raw := req.Object.Raw
-	pv := corev1.PersistentVolume{}
-	if _, _, err := universalDeserializer.Decode(raw, nil, &pv); err != nil {
-		return nil, fmt.Errorf("could not deserialize pv object: %v", err)
+	decoder := admission.NewDecoder(scheme)
+
+	// webhook.Admission negotiates both admissionregistration.k8s.io/v1 and
+	// the deprecated v1beta1 AdmissionReview envelopes on its own: it
+	// decodes either into the common v1 Request type, and
+	// writeResponseTyped echoes back whichever apiVersion the request
+	// actually arrived as. So a 1.22+ apiserver sending v1, and an older
+	// one still sending v1beta1, are both served correctly without any
+	// extra negotiation code here.
+	webhookServer := mgr.GetWebhookServer()
+	webhookServer.Register("/podmutate", &webhook.Admission{Handler: cosfirewallwebhook.NewPodSecurityDefaulter(mgr.GetClient(), decoder)})
+	webhookServer.Register("/pvmutate", &webhook.Admission{Handler: cosfirewallwebhook.NewPVSecurityMutator(mgr.GetClient(), decoder)})
+	webhookServer.Register("/pvvalidate", &webhook.Admission{Handler: cosfirewallwebhook.NewPVSecurityValidator(mgr.GetClient(), decoder)})
+
+	reconciler := &cosfirewall.Reconciler{
+		Client:         mgr.GetClient(),
+		FirewallClient: cosfirewall.NewIBMCOSFirewallClient(),
+		ResyncPeriod:   resyncPeriod,
 	}
-	// https://godoc.org/k8s.io/api/core/v1#PersistentVolume
-	// https://godoc.org/k8s.io/apimachinery/pkg/apis/meta/v1#ObjectMeta
-	// https://godoc.org/k8s.io/api/core/v1#PersistentVolumeSpec
-	// https://godoc.org/k8s.io/api/core/v1#PersistentVolumeSource
-	log.Printf("Info: PV Name %s", pv.Name)
-	if pv.Spec.FlexVolume != nil {
-		if strings.Contains(pv.Spec.FlexVolume.Driver, "ibmc-s3fs") {
-			confFW = true
-			log.Printf("Info: IBM Cloud S3FS Driver %s", pv.Spec.FlexVolume.Driver)
-			if key, ok := pv.Spec.FlexVolume.Options["bucket"]; ok {
-				bucketName = key
-			}
-			if pv.Spec.FlexVolume.SecretRef != nil {
-				secretName = pv.Spec.FlexVolume.SecretRef.Name
-				secretNameSpace = pv.Spec.FlexVolume.SecretRef.Namespace
-			} else {
-				confFW = false
-				log.Printf("Warn: Secret not set for %s", pv.Name)
-			}
-		} else {
-			log.Printf("Info: Other Driver %s", pv.Spec.FlexVolume.Driver)
-		}
-		if confFW {
-			log.Printf("Info: PV Bucket Name %s", bucketName)
-			log.Printf("Info: PV Secret Name %s", pv.Spec.FlexVolume.SecretRef.Name)
-			log.Printf("Info: PV Secret NameSpace %s", pv.Spec.FlexVolume.SecretRef.Namespace)
-		}
-	} else {
-		log.Printf("Info: Not a FlexVolume %s", pv.Name)
-	}
-	if !confFW {
-		return nil, nil
-	}
-	if len(secretName) > 0  && len(secretNameSpace) > 0 {
-		// pvSecret, err := goClient.CoreV1().Secrets(secretNameSpace).Get(context.TODO(), secretName, metav1.GetOptions{})
-		pvSecret, err := goClient.CoreV1().Secrets(secretNameSpace).Get(secretName, metav1.GetOptions{})
-		if err == nil {
-			if key, ok := pvSecret.Data["res-conf-apikey"]; ok {
-				resConfApiKey = string(key)
-			} else {
-				log.Printf("Warn: res-conf-apikey not set for %s", pv.Name)
-			}
-			if ips, ok := pvSecret.Data["allowed_ips"]; ok	{
-				allowedIPs   = string(ips)
-			} else {
-				log.Printf("Warn: allowed_ips not set for %s", pv.Name)
-			}
-		} else {
-			log.Printf("Error: Cannot retrieve Whitelist IPs for %s", pv.Name)
-		}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		log.Error(err, "unable to set up cosfirewall reconciler")
+		os.Exit(1)
 	}
 
-	if len(allowedIPs) > 0 && len(resConfApiKey) > 0 {
-		err := UpdateFirewallRules(allowedIPs, resConfApiKey, bucketName)
-		if err != nil {
-			fmt.Println("Error:", err)
-			log.Printf("Error: Cannot configure firewall for %s", pv.Name)
-		}
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		log.Error(err, "unable to set up health check")
+		os.Exit(1)
 	}
-	return nil, nil
-}
-
-func main() {
-	certPath := filepath.Join(tlsDir, tlsCertFile)
-	keyPath := filepath.Join(tlsDir, tlsKeyFile)
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		log.Fatal("Error: Cannot initialize server")
-	}
-	goClient, err = kubernetes.NewForConfig(config)
-	if err != nil {
-		log.Fatal("Error: Cannot initialize server")
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		log.Error(err, "unable to set up ready check")
+		os.Exit(1)
 	}
-	mux := http.NewServeMux()
-	// mux.Handle("/podmutate", admitFuncHandler(applyPODSecurity))
-	mux.Handle("/pvmutate", admitFuncHandler(applyPVSecurity))
-	log.Printf("--Started WebHook Server--")
-	server := &http.Server{
-		// We listen on port 8443 such that we do not need root privileges or extra capabilities for this server.
-		// The Service object will take care of mapping this port to the HTTPS port 443.
-		Addr:    ":8443",
-		Handler: mux,
+
+	log.Info("starting webhook server")
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		log.Error(err, "problem running manager")
+		os.Exit(1)
 	}
-	log.Fatal(server.ListenAndServeTLS(certPath, keyPath))
 }
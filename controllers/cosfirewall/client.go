@@ -0,0 +1,46 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+import (
+	"strings"
+
+	"github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/ibmcos"
+)
+
+// ibmCOSFirewallClient is the default FirewallClient, backed by the same
+// IBM COS resource-configuration API the mutating PV webhook talks to.
+type ibmCOSFirewallClient struct{}
+
+// NewIBMCOSFirewallClient returns the default, production FirewallClient.
+func NewIBMCOSFirewallClient() FirewallClient {
+	return ibmCOSFirewallClient{}
+}
+
+// GetAllowedIPs returns the IPs currently allow-listed for bucket.
+func (ibmCOSFirewallClient) GetAllowedIPs(apiKey, bucket string) ([]string, error) {
+	ips, err := ibmcos.GetFirewallRules(apiKey, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(ips, ","), nil
+}
+
+// SetAllowedIPs replaces the allow-list for bucket with ips.
+func (ibmCOSFirewallClient) SetAllowedIPs(apiKey, bucket string, ips []string) error {
+	return ibmcos.UpdateFirewallRules(strings.Join(ips, ","), apiKey, bucket)
+}
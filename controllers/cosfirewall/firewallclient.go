@@ -0,0 +1,28 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+// FirewallClient talks to the IBM COS resource-configuration API on behalf
+// of the reconciler. It is satisfied by the same client used by the
+// mutating PV webhook, kept as an interface here so reconciliation can be
+// exercised against a fake in tests.
+type FirewallClient interface {
+	// GetAllowedIPs returns the IPs currently allow-listed for bucket.
+	GetAllowedIPs(apiKey, bucket string) ([]string, error)
+	// SetAllowedIPs replaces the allow-list for bucket with ips.
+	SetAllowedIPs(apiKey, bucket string, ips []string) error
+}
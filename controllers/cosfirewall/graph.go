@@ -0,0 +1,108 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+import "sync"
+
+// bucketGraph is an in-memory index of {bucket -> allowed IPs -> referencing
+// PVs}, similar in spirit to the Kubernetes node-authorizer graph: it lets
+// the reconciler answer "what should this bucket's allow-list be right now"
+// without a full PersistentVolume list on every reconcile.
+type bucketGraph struct {
+	mu sync.RWMutex
+	// pvIPs maps a PV name to the allowed IPs it contributes to its bucket.
+	pvIPs map[string][]string
+	// pvBucket maps a PV name to the bucket it belongs to.
+	pvBucket map[string]string
+}
+
+func newBucketGraph() *bucketGraph {
+	return &bucketGraph{
+		pvIPs:    make(map[string][]string),
+		pvBucket: make(map[string]string),
+	}
+}
+
+// setPV records (or updates) the bucket and allowed IPs contributed by pv.
+func (g *bucketGraph) setPV(pv, bucket string, ips []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pvBucket[pv] = bucket
+	g.pvIPs[pv] = append([]string(nil), ips...)
+}
+
+// removePV drops pv from the graph, e.g. because it was deleted.
+func (g *bucketGraph) removePV(pv string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.pvBucket, pv)
+	delete(g.pvIPs, pv)
+}
+
+// desiredIPs returns the union of allowed IPs across every PV currently
+// bound to bucket, deduplicated.
+func (g *bucketGraph) desiredIPs(bucket string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	seen := make(map[string]struct{})
+	var ips []string
+	for pv, b := range g.pvBucket {
+		if b != bucket {
+			continue
+		}
+		for _, ip := range g.pvIPs[pv] {
+			if _, ok := seen[ip]; ok {
+				continue
+			}
+			seen[ip] = struct{}{}
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// pvsForBucket returns the names of the PVs currently bound to bucket.
+func (g *bucketGraph) pvsForBucket(bucket string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var pvs []string
+	for pv, b := range g.pvBucket {
+		if b == bucket {
+			pvs = append(pvs, pv)
+		}
+	}
+	return pvs
+}
+
+// buckets returns the distinct set of buckets currently tracked.
+func (g *bucketGraph) buckets() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	seen := make(map[string]struct{})
+	var out []string
+	for _, b := range g.pvBucket {
+		if _, ok := seen[b]; ok {
+			continue
+		}
+		seen[b] = struct{}{}
+		out = append(out, b)
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+import (
+	"sort"
+	"testing"
+)
+
+func sortedStrings(in []string) []string {
+	out := append([]string(nil), in...)
+	sort.Strings(out)
+	return out
+}
+
+func TestBucketGraphDesiredIPsUnionsAndDedupes(t *testing.T) {
+	g := newBucketGraph()
+	g.setPV("pv-a", "bucket-1", []string{"1.1.1.1", "2.2.2.2"})
+	g.setPV("pv-b", "bucket-1", []string{"2.2.2.2", "3.3.3.3"})
+	g.setPV("pv-c", "bucket-2", []string{"9.9.9.9"})
+
+	got := sortedStrings(g.desiredIPs("bucket-1"))
+	want := []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}
+	if len(got) != len(want) {
+		t.Fatalf("desiredIPs(bucket-1) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("desiredIPs(bucket-1) = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBucketGraphDesiredIPsEmptyForUnknownBucket(t *testing.T) {
+	g := newBucketGraph()
+	g.setPV("pv-a", "bucket-1", []string{"1.1.1.1"})
+
+	if got := g.desiredIPs("bucket-unknown"); len(got) != 0 {
+		t.Fatalf("desiredIPs(bucket-unknown) = %v, want empty", got)
+	}
+}
+
+func TestBucketGraphRemovePV(t *testing.T) {
+	g := newBucketGraph()
+	g.setPV("pv-a", "bucket-1", []string{"1.1.1.1"})
+	g.setPV("pv-b", "bucket-1", []string{"2.2.2.2"})
+
+	g.removePV("pv-a")
+
+	got := g.desiredIPs("bucket-1")
+	if len(got) != 1 || got[0] != "2.2.2.2" {
+		t.Fatalf("desiredIPs(bucket-1) after removePV = %v, want [2.2.2.2]", got)
+	}
+	if pvs := g.pvsForBucket("bucket-1"); len(pvs) != 1 || pvs[0] != "pv-b" {
+		t.Fatalf("pvsForBucket(bucket-1) after removePV = %v, want [pv-b]", pvs)
+	}
+}
+
+func TestBucketGraphSetPVUpdatesInPlace(t *testing.T) {
+	g := newBucketGraph()
+	g.setPV("pv-a", "bucket-1", []string{"1.1.1.1"})
+	g.setPV("pv-a", "bucket-1", []string{"2.2.2.2"})
+
+	got := g.desiredIPs("bucket-1")
+	if len(got) != 1 || got[0] != "2.2.2.2" {
+		t.Fatalf("desiredIPs(bucket-1) after re-setPV = %v, want [2.2.2.2]", got)
+	}
+}
+
+func TestBucketGraphPVsForBucket(t *testing.T) {
+	g := newBucketGraph()
+	g.setPV("pv-a", "bucket-1", []string{"1.1.1.1"})
+	g.setPV("pv-b", "bucket-2", []string{"2.2.2.2"})
+
+	got := sortedStrings(g.pvsForBucket("bucket-1"))
+	if len(got) != 1 || got[0] != "pv-a" {
+		t.Fatalf("pvsForBucket(bucket-1) = %v, want [pv-a]", got)
+	}
+}
+
+func TestBucketGraphBuckets(t *testing.T) {
+	g := newBucketGraph()
+	g.setPV("pv-a", "bucket-1", []string{"1.1.1.1"})
+	g.setPV("pv-b", "bucket-1", []string{"2.2.2.2"})
+	g.setPV("pv-c", "bucket-2", []string{"3.3.3.3"})
+
+	got := sortedStrings(g.buckets())
+	want := []string{"bucket-1", "bucket-2"}
+	if len(got) != len(want) {
+		t.Fatalf("buckets() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("buckets() = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// pvcVolumeNameIndex indexes PersistentVolumeClaims by the
+	// PersistentVolume they are bound to, so a PV can find its claims
+	// without listing every PVC in the cluster.
+	pvcVolumeNameIndex = "spec.volumeName"
+
+	// podPVCNameIndex indexes Pods by the names of the PVCs they mount,
+	// so a PVC can find the Pods currently using it.
+	podPVCNameIndex = "spec.volumes.persistentVolumeClaim.claimName"
+
+	// podNodeNameIndex indexes Pods by their scheduled node, so a Node
+	// event can find the Pods that might need a firewall recompute.
+	podNodeNameIndex = "spec.nodeName"
+)
+
+// setupIndexers registers the field indexers reconcileBucket's PodEgress
+// resolution depends on.
+func setupIndexers(ctx context.Context, mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &corev1.PersistentVolumeClaim{}, pvcVolumeNameIndex, func(obj client.Object) []string {
+		pvc := obj.(*corev1.PersistentVolumeClaim)
+		if pvc.Spec.VolumeName == "" {
+			return nil
+		}
+		return []string{pvc.Spec.VolumeName}
+	}); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &corev1.Pod{}, podPVCNameIndex, func(obj client.Object) []string {
+		pod := obj.(*corev1.Pod)
+		var claims []string
+		for _, vol := range pod.Spec.Volumes {
+			if vol.PersistentVolumeClaim != nil {
+				claims = append(claims, vol.PersistentVolumeClaim.ClaimName)
+			}
+		}
+		return claims
+	}); err != nil {
+		return err
+	}
+
+	return mgr.GetFieldIndexer().IndexField(ctx, &corev1.Pod{}, podNodeNameIndex, func(obj client.Object) []string {
+		pod := obj.(*corev1.Pod)
+		if pod.Spec.NodeName == "" {
+			return nil
+		}
+		return []string{pod.Spec.NodeName}
+	})
+}
@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cosfirewallv1alpha1 "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/apis/cosfirewall/v1alpha1"
+)
+
+// policyToPVRequests maps a COSFirewallPolicy event to reconcile requests
+// for every ibmc-s3fs PersistentVolume bound to the same bucket, so that
+// editing a policy's allow-list re-triggers drift correction without
+// waiting for the next PV event or resync tick.
+func policyToPVRequests(c client.Client) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		policy, ok := obj.(*cosfirewallv1alpha1.COSFirewallPolicy)
+		if !ok {
+			return nil
+		}
+
+		var pvs corev1.PersistentVolumeList
+		if err := c.List(ctx, &pvs); err != nil {
+			log.Error(err, "failed to list PersistentVolumes for policy mapping", "policy", policy.Name)
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for i := range pvs.Items {
+			pv := &pvs.Items[i]
+			if pv.Spec.FlexVolume == nil || !strings.Contains(pv.Spec.FlexVolume.Driver, "ibmc-s3fs") {
+				continue
+			}
+			if pv.Spec.FlexVolume.Options["bucket"] != policy.Spec.BucketName {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: apitypes.NamespacedName{Name: pv.Name}})
+		}
+		return requests
+	})
+}
+
+// podToPVRequests maps a Pod event to a reconcile request for the PV bound
+// to whichever PVC the pod mounts, so a Pod starting, rescheduling, or
+// terminating recomputes the bucket's PodEgress allow-list promptly.
+func podToPVRequests(c client.Client) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return nil
+		}
+		return pvRequestsForPod(ctx, c, pod)
+	})
+}
+
+// nodeToPVRequests maps a Node event (e.g. its external IP or egress-IP
+// annotation changing) to reconcile requests for the PVs of every Pod
+// currently scheduled there.
+func nodeToPVRequests(c client.Client) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		node, ok := obj.(*corev1.Node)
+		if !ok {
+			return nil
+		}
+
+		var pods corev1.PodList
+		if err := c.List(ctx, &pods, client.MatchingFields{podNodeNameIndex: node.Name}); err != nil {
+			log.Error(err, "failed to list Pods for node mapping", "node", node.Name)
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for i := range pods.Items {
+			requests = append(requests, pvRequestsForPod(ctx, c, &pods.Items[i])...)
+		}
+		return requests
+	})
+}
+
+// pvRequestsForPod resolves the PV backing every PVC pod mounts.
+func pvRequestsForPod(ctx context.Context, c client.Client, pod *corev1.Pod) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, vol := range pod.Spec.Volumes {
+		if vol.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := c.Get(ctx, apitypes.NamespacedName{Namespace: pod.Namespace, Name: vol.PersistentVolumeClaim.ClaimName}, pvc); err != nil {
+			continue
+		}
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: apitypes.NamespacedName{Name: pvc.Spec.VolumeName}})
+	}
+	return requests
+}
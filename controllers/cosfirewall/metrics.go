@@ -0,0 +1,37 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// firewallDriftTotal counts each allow-list entry the reconciler had to add
+// or remove because the COS bucket's actual allow-list was out of sync with
+// the desired one, broken down by bucket and the kind of drift.
+var firewallDriftTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "firewall_drift_total",
+		Help: "Number of IP allow-list entries added or removed to correct drift between the desired and actual IBM COS bucket firewall.",
+	},
+	[]string{"bucket", "action"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(firewallDriftTotal)
+}
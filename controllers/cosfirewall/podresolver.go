@@ -0,0 +1,100 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// egressIPAnnotation, when set on a Node, overrides its detected external
+// IP as the address Pods scheduled there egress traffic from (e.g. behind a
+// NAT gateway or an egress-IP controller).
+const egressIPAnnotation = "cosfirewall.ibm.com/egress-ip"
+
+// podEgressIPsForPV resolves the egress IPs of every non-terminating Pod
+// that mounts a PVC bound to pvName. Terminating pods (DeletionTimestamp
+// set) are skipped so that a pod's shutdown doesn't flap the firewall
+// before its replacement has started and been accounted for.
+func podEgressIPsForPV(ctx context.Context, c client.Client, pvName string) ([]string, error) {
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := c.List(ctx, &pvcs, client.MatchingFields{pvcVolumeNameIndex: pvName}); err != nil {
+		return nil, err
+	}
+
+	nodeIPCache := make(map[string]string)
+	var ips []string
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+
+		var pods corev1.PodList
+		if err := c.List(ctx, &pods,
+			client.InNamespace(pvc.Namespace),
+			client.MatchingFields{podPVCNameIndex: pvc.Name},
+		); err != nil {
+			return nil, err
+		}
+
+		for j := range pods.Items {
+			pod := &pods.Items[j]
+			if pod.DeletionTimestamp != nil || pod.Spec.NodeName == "" {
+				continue
+			}
+
+			ip, ok := nodeIPCache[pod.Spec.NodeName]
+			if !ok {
+				var err error
+				ip, err = nodeEgressIP(ctx, c, pod.Spec.NodeName)
+				if err != nil {
+					return nil, err
+				}
+				nodeIPCache[pod.Spec.NodeName] = ip
+			}
+			if ip != "" {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// nodeEgressIP returns the egress IP for nodeName: the egressIPAnnotation
+// if set, otherwise the node's first external IP, otherwise its first
+// internal IP.
+func nodeEgressIP(ctx context.Context, c client.Client, nodeName string) (string, error) {
+	node := &corev1.Node{}
+	if err := c.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return "", err
+	}
+
+	if ip := node.Annotations[egressIPAnnotation]; ip != "" {
+		return ip, nil
+	}
+
+	var internal string
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeExternalIP {
+			return addr.Address, nil
+		}
+		if addr.Type == corev1.NodeInternalIP && internal == "" {
+			internal = addr.Address
+		}
+	}
+	return internal, nil
+}
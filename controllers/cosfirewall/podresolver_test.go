@@ -0,0 +1,194 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	return scheme
+}
+
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	return fake.NewClientBuilder().
+		WithScheme(newTestScheme(t)).
+		WithIndex(&corev1.PersistentVolumeClaim{}, pvcVolumeNameIndex, func(obj client.Object) []string {
+			pvc := obj.(*corev1.PersistentVolumeClaim)
+			if pvc.Spec.VolumeName == "" {
+				return nil
+			}
+			return []string{pvc.Spec.VolumeName}
+		}).
+		WithIndex(&corev1.Pod{}, podPVCNameIndex, func(obj client.Object) []string {
+			pod := obj.(*corev1.Pod)
+			var claims []string
+			for _, vol := range pod.Spec.Volumes {
+				if vol.PersistentVolumeClaim != nil {
+					claims = append(claims, vol.PersistentVolumeClaim.ClaimName)
+				}
+			}
+			return claims
+		}).
+		WithIndex(&corev1.Pod{}, podNodeNameIndex, func(obj client.Object) []string {
+			pod := obj.(*corev1.Pod)
+			if pod.Spec.NodeName == "" {
+				return nil
+			}
+			return []string{pod.Spec.NodeName}
+		}).
+		WithObjects(objs...).
+		Build()
+}
+
+func TestNodeEgressIPPrefersAnnotation(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "node-1",
+			Annotations: map[string]string{egressIPAnnotation: "10.0.0.9"},
+		},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.1"},
+			},
+		},
+	}
+	c := newTestClient(t, node)
+
+	ip, err := nodeEgressIP(context.Background(), c, "node-1")
+	if err != nil {
+		t.Fatalf("nodeEgressIP: %v", err)
+	}
+	if ip != "10.0.0.9" {
+		t.Fatalf("nodeEgressIP = %q, want annotation override 10.0.0.9", ip)
+	}
+}
+
+func TestNodeEgressIPPrefersExternalOverInternal(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.1"},
+			},
+		},
+	}
+	c := newTestClient(t, node)
+
+	ip, err := nodeEgressIP(context.Background(), c, "node-1")
+	if err != nil {
+		t.Fatalf("nodeEgressIP: %v", err)
+	}
+	if ip != "203.0.113.1" {
+		t.Fatalf("nodeEgressIP = %q, want external IP 203.0.113.1", ip)
+	}
+}
+
+func TestNodeEgressIPFallsBackToInternal(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			},
+		},
+	}
+	c := newTestClient(t, node)
+
+	ip, err := nodeEgressIP(context.Background(), c, "node-1")
+	if err != nil {
+		t.Fatalf("nodeEgressIP: %v", err)
+	}
+	if ip != "10.0.0.1" {
+		t.Fatalf("nodeEgressIP = %q, want internal IP 10.0.0.1", ip)
+	}
+}
+
+func TestPodEgressIPsForPVSkipsTerminatingPods(t *testing.T) {
+	now := metav1.NewTime(time.Unix(0, 0))
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "203.0.113.1"}},
+		},
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1", Namespace: "ns"},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-1"},
+	}
+	runningPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-running", Namespace: "ns"},
+		Spec: corev1.PodSpec{
+			NodeName: "node-1",
+			Volumes: []corev1.Volume{
+				{VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc-1"}}},
+			},
+		},
+	}
+	terminatingPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pod-terminating",
+			Namespace:         "ns",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{"example.com/block-deletion"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node-1",
+			Volumes: []corev1.Volume{
+				{VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc-1"}}},
+			},
+		},
+	}
+
+	c := newTestClient(t, node, pvc, runningPod, terminatingPod)
+
+	ips, err := podEgressIPsForPV(context.Background(), c, "pv-1")
+	if err != nil {
+		t.Fatalf("podEgressIPsForPV: %v", err)
+	}
+	if len(ips) != 1 || ips[0] != "203.0.113.1" {
+		t.Fatalf("podEgressIPsForPV = %v, want [203.0.113.1] (terminating pod excluded)", ips)
+	}
+}
+
+func TestPodEgressIPsForPVNoMatchingPVC(t *testing.T) {
+	c := newTestClient(t)
+
+	ips, err := podEgressIPsForPV(context.Background(), c, "pv-unknown")
+	if err != nil {
+		t.Fatalf("podEgressIPsForPV: %v", err)
+	}
+	if len(ips) != 0 {
+		t.Fatalf("podEgressIPsForPV = %v, want empty", ips)
+	}
+}
+
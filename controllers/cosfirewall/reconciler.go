@@ -0,0 +1,285 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cosfirewall reconciles the IBM COS bucket firewall against
+// cluster state. The mutating PV webhook applies firewall rules once, at
+// admission time; if the bucket's firewall is edited out-of-band, or
+// admission fails partway, the cluster and COS drift silently. This
+// reconciler watches PersistentVolume and COSFirewallPolicy objects,
+// maintains an in-memory {bucket -> allowed IPs -> referencing PVs} graph,
+// and periodically diffs desired vs. actual allow-lists, correcting drift.
+package cosfirewall
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	cosfirewallv1alpha1 "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/apis/cosfirewall/v1alpha1"
+	"github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/cosfirewallpolicy"
+)
+
+var log = logf.Log.WithName("cosfirewall-controller")
+
+// DefaultResyncPeriod is used when Reconciler.ResyncPeriod is left unset.
+const DefaultResyncPeriod = 5 * time.Minute
+
+// Reconciler drifts-checks the IBM COS firewall for every bucket referenced
+// by an ibmc-s3fs PersistentVolume.
+type Reconciler struct {
+	client.Client
+
+	// FirewallClient talks to the IBM COS resource-configuration API.
+	FirewallClient FirewallClient
+
+	// ResyncPeriod bounds how long a bucket can drift before it is
+	// rechecked even without a triggering PV/policy event.
+	ResyncPeriod time.Duration
+
+	graph *bucketGraph
+}
+
+// Reconcile implements reconcile.Reconciler. It is triggered by
+// PersistentVolume changes, keeps the in-memory graph up to date, and then
+// reconciles the affected bucket's firewall.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if r.graph == nil {
+		r.graph = newBucketGraph()
+	}
+	log := log.WithValues("pv", req.Name)
+
+	pv := &corev1.PersistentVolume{}
+	if err := r.Get(ctx, req.NamespacedName, pv); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.graph.removePV(req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if pv.Spec.FlexVolume == nil || !strings.Contains(pv.Spec.FlexVolume.Driver, "ibmc-s3fs") || pv.Spec.FlexVolume.SecretRef == nil {
+		r.graph.removePV(pv.Name)
+		return ctrl.Result{}, nil
+	}
+	bucket := pv.Spec.FlexVolume.Options["bucket"]
+	secretRef := pv.Spec.FlexVolume.SecretRef
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, apitypes.NamespacedName{Namespace: secretRef.Namespace, Name: secretRef.Name}, secret); err != nil {
+		log.Error(err, "cannot retrieve secret for PV")
+		return ctrl.Result{RequeueAfter: r.resyncPeriod()}, nil
+	}
+
+	ips := strings.Split(string(secret.Data["allowed_ips"]), ",")
+	r.graph.setPV(pv.Name, bucket, ips)
+
+	policy, err := cosfirewallpolicy.FindForBucket(ctx, r.Client, bucket)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if policy == nil {
+		log.Info("no COSFirewallPolicy for bucket, skipping drift check", "bucket", bucket)
+		return ctrl.Result{RequeueAfter: r.resyncPeriod()}, nil
+	}
+	if !policy.Status.Admitted {
+		// Like PVSecurityMutator, wait for the validating webhook to admit
+		// the policy at least once before the reconciler starts pushing
+		// its AllowedIPs to the actual bucket.
+		log.Info("policy not yet admitted, skipping drift check", "bucket", bucket)
+		return ctrl.Result{RequeueAfter: r.resyncPeriod()}, nil
+	}
+
+	if err := r.reconcileBucket(ctx, bucket, policy); err != nil {
+		log.Error(err, "failed to reconcile bucket firewall", "bucket", bucket)
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: r.resyncPeriod()}, nil
+}
+
+// reconcileBucket diffs the desired allow-list against the actual IBM COS
+// firewall, and corrects drift with exponential backoff on API failures.
+// The desired list depends on the policy's Mode: Static (or unset) is the
+// union of the policy's AllowedIPs and every referencing PV's allowed_ips;
+// PodEgress is only the egress IPs of the Pods using the bucket's PVs;
+// Merged is the union of both.
+func (r *Reconciler) reconcileBucket(ctx context.Context, bucket string, policy *cosfirewallv1alpha1.COSFirewallPolicy) error {
+	apiKey, err := r.resConfApiKey(ctx, policy)
+	if err != nil {
+		return err
+	}
+	if apiKey == "" {
+		return nil
+	}
+
+	var desired []string
+	switch policy.Spec.Mode {
+	case cosfirewallv1alpha1.FirewallModePodEgress, cosfirewallv1alpha1.FirewallModeMerged:
+		egressIPs, err := r.podEgressIPsForBucket(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		desired = append(desired, egressIPs...)
+		if policy.Spec.Mode == cosfirewallv1alpha1.FirewallModeMerged {
+			desired = append(desired, policy.Spec.AllowedIPs...)
+			desired = append(desired, r.graph.desiredIPs(bucket)...)
+		}
+	default: // FirewallModeStatic, or unset
+		desired = append(desired, policy.Spec.AllowedIPs...)
+		desired = append(desired, r.graph.desiredIPs(bucket)...)
+	}
+	desired = dedupeAndSort(desired)
+
+	backoff := wait.Backoff{Duration: time.Second, Factor: 2, Steps: 5}
+	var actual []string
+	if err := retryOnError(backoff, func() error {
+		var err error
+		actual, err = r.FirewallClient.GetAllowedIPs(apiKey, bucket)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	added, removed := diff(dedupeAndSort(actual), desired)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	for range added {
+		firewallDriftTotal.WithLabelValues(bucket, "add").Inc()
+	}
+	for range removed {
+		firewallDriftTotal.WithLabelValues(bucket, "remove").Inc()
+	}
+
+	return retryOnError(backoff, func() error {
+		return r.FirewallClient.SetAllowedIPs(apiKey, bucket, desired)
+	})
+}
+
+// podEgressIPsForBucket unions the egress IPs of every Pod currently
+// mounting a PVC bound to one of bucket's PVs.
+func (r *Reconciler) podEgressIPsForBucket(ctx context.Context, bucket string) ([]string, error) {
+	var ips []string
+	for _, pv := range r.graph.pvsForBucket(bucket) {
+		pvIPs, err := podEgressIPsForPV(ctx, r.Client, pv)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, pvIPs...)
+	}
+	return ips, nil
+}
+
+func (r *Reconciler) resConfApiKey(ctx context.Context, policy *cosfirewallv1alpha1.COSFirewallPolicy) (string, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, apitypes.NamespacedName{Namespace: policy.Spec.SecretRef.Namespace, Name: policy.Spec.SecretRef.Name}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(secret.Data["res-conf-apikey"]), nil
+}
+
+func (r *Reconciler) resyncPeriod() time.Duration {
+	if r.ResyncPeriod > 0 {
+		return r.ResyncPeriod
+	}
+	return DefaultResyncPeriod
+}
+
+// SetupWithManager registers the reconciler with mgr, watching
+// PersistentVolume objects directly, COSFirewallPolicy objects via a
+// mapping back to the PVs referencing the same bucket, and (for
+// PodEgress/Merged policies) Pod and Node events so that a pod rescheduling
+// to a new node triggers a firewall update within seconds.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.graph = newBucketGraph()
+
+	if err := setupIndexers(context.Background(), mgr); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.PersistentVolume{}).
+		Watches(&cosfirewallv1alpha1.COSFirewallPolicy{}, policyToPVRequests(mgr.GetClient())).
+		Watches(&corev1.Pod{}, podToPVRequests(mgr.GetClient())).
+		Watches(&corev1.Node{}, nodeToPVRequests(mgr.GetClient())).
+		Complete(r)
+}
+
+func dedupeAndSort(in []string) []string {
+	seen := make(map[string]struct{}, len(in))
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// diff returns the entries present in desired but not actual (added) and
+// the entries present in actual but not desired (removed). Both inputs
+// must already be sorted.
+func diff(actual, desired []string) (added, removed []string) {
+	actualSet := make(map[string]struct{}, len(actual))
+	for _, a := range actual {
+		actualSet[a] = struct{}{}
+	}
+	desiredSet := make(map[string]struct{}, len(desired))
+	for _, d := range desired {
+		desiredSet[d] = struct{}{}
+	}
+	for _, d := range desired {
+		if _, ok := actualSet[d]; !ok {
+			added = append(added, d)
+		}
+	}
+	for _, a := range actual {
+		if _, ok := desiredSet[a]; !ok {
+			removed = append(removed, a)
+		}
+	}
+	return added, removed
+}
+
+func retryOnError(backoff wait.Backoff, fn func() error) error {
+	return wait.ExponentialBackoff(backoff, func() (bool, error) {
+		if err := fn(); err != nil {
+			log.Error(err, "retrying after IBM COS API error")
+			return false, nil
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,105 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosfirewall
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupeAndSort(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{
+			name: "dedupes and sorts",
+			in:   []string{"3.3.3.3", "1.1.1.1", "1.1.1.1", "2.2.2.2"},
+			want: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"},
+		},
+		{
+			name: "drops blank and whitespace-only entries",
+			in:   []string{" ", "1.1.1.1", "", "  2.2.2.2  "},
+			want: []string{"1.1.1.1", "2.2.2.2"},
+		},
+		{
+			name: "nil in, nil-equivalent out",
+			in:   nil,
+			want: []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := dedupeAndSort(tc.in)
+			if len(got) == 0 && len(tc.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("dedupeAndSort(%v) = %v, want %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	cases := []struct {
+		name        string
+		actual      []string
+		desired     []string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{
+			name:    "no change",
+			actual:  []string{"1.1.1.1", "2.2.2.2"},
+			desired: []string{"1.1.1.1", "2.2.2.2"},
+		},
+		{
+			name:      "additions only",
+			actual:    []string{"1.1.1.1"},
+			desired:   []string{"1.1.1.1", "2.2.2.2"},
+			wantAdded: []string{"2.2.2.2"},
+		},
+		{
+			name:        "removals only",
+			actual:      []string{"1.1.1.1", "2.2.2.2"},
+			desired:     []string{"1.1.1.1"},
+			wantRemoved: []string{"2.2.2.2"},
+		},
+		{
+			name:        "both additions and removals",
+			actual:      []string{"1.1.1.1", "2.2.2.2"},
+			desired:     []string{"2.2.2.2", "3.3.3.3"},
+			wantAdded:   []string{"3.3.3.3"},
+			wantRemoved: []string{"1.1.1.1"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			added, removed := diff(tc.actual, tc.desired)
+			if !reflect.DeepEqual(added, tc.wantAdded) {
+				t.Errorf("diff() added = %v, want %v", added, tc.wantAdded)
+			}
+			if !reflect.DeepEqual(removed, tc.wantRemoved) {
+				t.Errorf("diff() removed = %v, want %v", removed, tc.wantRemoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 contains the COSFirewallPolicy custom resource, the
+// GitOps-friendly source of truth for which IPs are allowed to reach an IBM
+// COS bucket. When a policy has Enforce set, the PV admission webhooks reject
+// a secret whose `allowed_ips` would widen the policy's allow-list.
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// FirewallMode selects how a COSFirewallPolicy's allow-list is computed.
+type FirewallMode string
+
+const (
+	// FirewallModeStatic allow-lists AllowedIPs together with the
+	// `allowed_ips` of every governed PV's secret: operators must keep
+	// both up to date by hand.
+	FirewallModeStatic FirewallMode = "Static"
+
+	// FirewallModePodEgress derives the allow-list from the egress IPs of
+	// the Pods currently mounting a PVC bound to a governed PV, instead
+	// of requiring AllowedIPs to be hard-coded.
+	FirewallModePodEgress FirewallMode = "PodEgress"
+
+	// FirewallModeMerged allow-lists the union of the Static IPs
+	// (AllowedIPs and the governed PVs' secret `allowed_ips`) and the
+	// PodEgress-derived IPs.
+	FirewallModeMerged FirewallMode = "Merged"
+)
+
+// COSFirewallPolicySpec describes the desired firewall configuration for a
+// single IBM COS bucket.
+type COSFirewallPolicySpec struct {
+	// BucketName is the IBM COS bucket this policy governs.
+	BucketName string `json:"bucketName"`
+
+	// AllowedIPs is the set of IPs/CIDRs permitted to reach BucketName.
+	// Ignored when Mode is PodEgress.
+	AllowedIPs []string `json:"allowedIPs"`
+
+	// SecretRef points at the secret carrying the resource-configuration
+	// API key used to apply the firewall rules.
+	SecretRef corev1.SecretReference `json:"secretRef"`
+
+	// Enforce, when true, causes PV admission to reject volumes whose
+	// bucket has no matching policy, or whose secret's allow-list is not
+	// a subset of AllowedIPs. When false the policy is advisory only.
+	// Ignored when Mode is PodEgress or Merged, since the allow-list is
+	// no longer solely operator-declared.
+	Enforce bool `json:"enforce"`
+
+	// Mode selects how the allow-list is computed. Defaults to Static
+	// when unset.
+	// +optional
+	Mode FirewallMode `json:"mode,omitempty"`
+}
+
+// COSFirewallPolicyStatus reports the last-observed state of a policy.
+type COSFirewallPolicyStatus struct {
+	// Admitted is true once a PV admission has validated against this
+	// policy at least once. PVSecurityValidator is the only thing that
+	// sets it; PVSecurityMutator and the drift reconciler both require it
+	// before they will push AllowedIPs to the actual IBM COS bucket, so a
+	// policy can't reconfigure cloud firewall state until it has been
+	// vetted by the validating webhook.
+	Admitted bool `json:"admitted,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// COSFirewallPolicy is the namespaced CRD operators use to declare which IPs
+// may reach a given IBM COS bucket, instead of hard-coding `allowed_ips` in
+// the PV's secret.
+type COSFirewallPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   COSFirewallPolicySpec   `json:"spec"`
+	Status COSFirewallPolicyStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// COSFirewallPolicyList is a list of COSFirewallPolicy resources.
+type COSFirewallPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []COSFirewallPolicy `json:"items"`
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *COSFirewallPolicy) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(COSFirewallPolicy)
+	out.TypeMeta = in.TypeMeta
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	out.Spec = in.Spec
+	out.Spec.AllowedIPs = append([]string(nil), in.Spec.AllowedIPs...)
+	out.Status = in.Status
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *COSFirewallPolicyList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(COSFirewallPolicyList)
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		out.Items = make([]COSFirewallPolicy, len(in.Items))
+		for i := range in.Items {
+			out.Items[i] = *in.Items[i].DeepCopyObject().(*COSFirewallPolicy)
+		}
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cosfirewallpolicy looks up the COSFirewallPolicy governing a given
+// IBM COS bucket. It is the single place that implements "first match wins"
+// so the PV admission webhooks and the drift reconciler cannot disagree on
+// which policy governs a bucket that more than one policy claims.
+package cosfirewallpolicy
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cosfirewallv1alpha1 "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/apis/cosfirewall/v1alpha1"
+)
+
+// FindForBucket returns the COSFirewallPolicy whose spec.bucketName matches
+// bucketName, or nil if none exists. Policies are namespaced, so all
+// namespaces are searched via c; if more than one policy claims the same
+// bucket, the first one encountered in the list wins and it is the
+// operator's responsibility to keep at most one policy per bucket.
+func FindForBucket(ctx context.Context, c client.Client, bucketName string) (*cosfirewallv1alpha1.COSFirewallPolicy, error) {
+	var list cosfirewallv1alpha1.COSFirewallPolicyList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		if list.Items[i].Spec.BucketName == bucketName {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, nil
+}
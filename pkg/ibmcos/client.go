@@ -0,0 +1,159 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcos is a minimal client for the IBM Cloud Object Storage
+// Resource Configuration API's bucket firewall endpoint
+// (https://cloud.ibm.com/apidocs/cos/cos-configuration). It is the single
+// place that turns a `res-conf-apikey` into IAM credentials and talks to IBM
+// COS, so both the PV mutating webhook and the drift reconciler apply
+// firewall rules the same way.
+package ibmcos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	iamTokenURL          = "https://iam.cloud.ibm.com/identity/token"
+	resourceConfigAPIURL = "https://config.cloud-object-storage.cloud.ibm.com/v1/b"
+	requestTimeout       = 30 * time.Second
+)
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+// bucketFirewall mirrors the `firewall` object in the Resource
+// Configuration API's bucket representation.
+type bucketFirewall struct {
+	Firewall struct {
+		AllowedIP []string `json:"allowed_ip"`
+	} `json:"firewall"`
+}
+
+// GetFirewallRules returns the comma-separated allow-list currently
+// configured on bucket, authenticating with apiKey.
+func GetFirewallRules(apiKey, bucket string) (string, error) {
+	token, err := iamAccessToken(apiKey)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, resourceConfigAPIURL+"/"+url.PathEscape(bucket), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	body, err := do(req)
+	if err != nil {
+		return "", fmt.Errorf("getting firewall config for bucket %s: %w", bucket, err)
+	}
+
+	var cfg bucketFirewall
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		return "", fmt.Errorf("decoding firewall config for bucket %s: %w", bucket, err)
+	}
+	return strings.Join(cfg.Firewall.AllowedIP, ","), nil
+}
+
+// UpdateFirewallRules replaces bucket's allow-list with allowedIPs (a
+// comma-separated list), authenticating with apiKey.
+func UpdateFirewallRules(allowedIPs, apiKey, bucket string) error {
+	token, err := iamAccessToken(apiKey)
+	if err != nil {
+		return err
+	}
+
+	var ips []string
+	for _, ip := range strings.Split(allowedIPs, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+
+	var payload bucketFirewall
+	payload.Firewall.AllowedIP = ips
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, resourceConfigAPIURL+"/"+url.PathEscape(bucket), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	if _, err := do(req); err != nil {
+		return fmt.Errorf("updating firewall config for bucket %s: %w", bucket, err)
+	}
+	return nil
+}
+
+// iamAccessToken exchanges apiKey for a short-lived IAM bearer token via IBM
+// Cloud's token endpoint, the same flow the IBM COS CLI/SDKs use.
+func iamAccessToken(apiKey string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "urn:ibm:params:oauth:grant-type:apikey")
+	form.Set("apikey", apiKey)
+
+	req, err := http.NewRequest(http.MethodPost, iamTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	body, err := do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting IAM token: %w", err)
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", fmt.Errorf("decoding IAM token response: %w", err)
+	}
+	return tok.AccessToken, nil
+}
+
+// do executes req and returns the response body, treating any non-2xx
+// status as an error.
+func do(req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
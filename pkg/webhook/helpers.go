@@ -0,0 +1,56 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// marshalOrEmpty marshals obj, returning an empty JSON object on failure so
+// that callers constructing an admission.Response do not need to plumb a
+// second error return through PatchResponseFromRaw.
+func marshalOrEmpty(obj interface{}) []byte {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return []byte("{}")
+	}
+	return raw
+}
+
+// ipsNotIn returns the entries of ips that are not present in allowed,
+// trimming whitespace and ignoring empty entries.
+func ipsNotIn(ips []string, allowed []string) []string {
+	var missing []string
+	for _, ip := range ips {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			continue
+		}
+		found := false
+		for _, a := range allowed {
+			if ip == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, ip)
+		}
+	}
+	return missing
+}
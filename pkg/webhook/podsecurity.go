@@ -0,0 +1,84 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// PodSecurityDefaulter implements admission.Handler for Pod creation. For
+// every pod that is created (outside of Kubernetes namespaces), it first
+// checks if `runAsNonRoot` is set. If it is not, it is set to `true`, or
+// to `false` when `runAsUser` is explicitly 0. Furthermore, if `runAsUser` is not set (and
+// `runAsNonRoot` was not initially set), it defaults `runAsUser` to a value
+// of 1234.
+//
+// To demonstrate how requests can be rejected, this webhook further
+// validates that the `runAsNonRoot` setting does not conflict with the
+// `runAsUser` setting - i.e., if the former is set to `true`, the latter
+// must not be `0`. Note that we combine both the setting of defaults and
+// the check for potential conflicts in one webhook; ideally, the latter
+// would be performed in a validating webhook admission controller.
+type PodSecurityDefaulter struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+// NewPodSecurityDefaulter builds a PodSecurityDefaulter bound to decoder.
+func NewPodSecurityDefaulter(c client.Client, decoder *admission.Decoder) *PodSecurityDefaulter {
+	return &PodSecurityDefaulter{Client: c, decoder: decoder}
+}
+
+// Handle implements admission.Handler.
+func (d *PodSecurityDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+	if err := d.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var runAsNonRoot *bool
+	var runAsUser *int64
+	if pod.Spec.SecurityContext != nil {
+		runAsNonRoot = pod.Spec.SecurityContext.RunAsNonRoot
+		runAsUser = pod.Spec.SecurityContext.RunAsUser
+	}
+
+	if runAsNonRoot == nil {
+		if pod.Spec.SecurityContext == nil {
+			pod.Spec.SecurityContext = &corev1.PodSecurityContext{}
+		}
+		// The value must not be true if runAsUser is set to 0, as otherwise we would create a conflicting
+		// configuration ourselves.
+		nonRoot := runAsUser == nil || *runAsUser != 0
+		pod.Spec.SecurityContext.RunAsNonRoot = &nonRoot
+
+		if runAsUser == nil {
+			defaultUser := int64(1234)
+			pod.Spec.SecurityContext.RunAsUser = &defaultUser
+		}
+	} else if *runAsNonRoot && (runAsUser != nil && *runAsUser == 0) {
+		// Make sure that the settings are not contradictory, and fail the object creation if they are.
+		return admission.Denied("runAsNonRoot specified, but runAsUser set to 0 (the root user)")
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshalOrEmpty(pod))
+}
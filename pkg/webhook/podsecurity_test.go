@@ -0,0 +1,85 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newPodAdmissionRequest(t *testing.T, pod *corev1.Pod) admission.Request {
+	t.Helper()
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("marshal Pod: %v", err)
+	}
+	return admission.Request{AdmissionRequest: admissionv1Request(raw)}
+}
+
+func boolPtr(b bool) *bool    { return &b }
+func int64Ptr(i int64) *int64 { return &i }
+
+func TestPodSecurityDefaulterHandle(t *testing.T) {
+	scheme := newTestScheme(t)
+	decoder := admission.NewDecoder(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	d := NewPodSecurityDefaulter(c, decoder)
+
+	cases := []struct {
+		name            string
+		securityContext *corev1.PodSecurityContext
+		wantAllowed     bool
+	}{
+		{
+			name:        "unset runAsNonRoot and runAsUser get sensible defaults",
+			wantAllowed: true,
+		},
+		{
+			name:            "runAsNonRoot true conflicting with runAsUser 0 is denied",
+			securityContext: &corev1.PodSecurityContext{RunAsNonRoot: boolPtr(true), RunAsUser: int64Ptr(0)},
+			wantAllowed:     false,
+		},
+		{
+			name:            "already-consistent settings are allowed unmodified",
+			securityContext: &corev1.PodSecurityContext{RunAsNonRoot: boolPtr(true), RunAsUser: int64Ptr(1000)},
+			wantAllowed:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod-1"},
+				Spec:       corev1.PodSpec{SecurityContext: tc.securityContext},
+			}
+
+			resp := d.Handle(context.Background(), newPodAdmissionRequest(t, pod))
+			if resp.Allowed != tc.wantAllowed {
+				t.Fatalf("Handle().Allowed = %v, want %v (result: %+v)", resp.Allowed, tc.wantAllowed, resp.Result)
+			}
+			if tc.name == "unset runAsNonRoot and runAsUser get sensible defaults" && len(resp.Patches) == 0 {
+				t.Fatalf("Handle() produced no patches, want a securityContext default to be added")
+			}
+		})
+	}
+}
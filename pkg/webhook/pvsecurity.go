@@ -0,0 +1,139 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	cosfirewallv1alpha1 "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/apis/cosfirewall/v1alpha1"
+	"github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/cosfirewallpolicy"
+	"github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/ibmcos"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var pvLog = logf.Log.WithName("pvsecurity")
+
+// PVSecurityMutator implements admission.Handler for PersistentVolume
+// creation. It looks at ibmc-s3fs FlexVolume PVs, resolves the bucket's
+// COSFirewallPolicy, and - so long as the policy has been admitted and, when
+// the policy enforces, its allow-list covers the secret's allowed_ips -
+// applies the secret's allowed_ips to the IBM COS bucket. With Enforce off
+// the secret's allowed_ips are applied without a coverage check.
+type PVSecurityMutator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+// NewPVSecurityMutator builds a PVSecurityMutator bound to decoder.
+func NewPVSecurityMutator(c client.Client, decoder *admission.Decoder) *PVSecurityMutator {
+	return &PVSecurityMutator{Client: c, decoder: decoder}
+}
+
+// Handle implements admission.Handler.
+func (m *PVSecurityMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	log := pvLog.WithValues("pv", req.Name)
+
+	pv := &corev1.PersistentVolume{}
+	if err := m.decoder.Decode(req, pv); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if pv.Spec.FlexVolume == nil || !strings.Contains(pv.Spec.FlexVolume.Driver, "ibmc-s3fs") {
+		return admission.Allowed("not an ibmc-s3fs volume")
+	}
+
+	bucketName := pv.Spec.FlexVolume.Options["bucket"]
+
+	policy, err := cosfirewallpolicy.FindForBucket(ctx, m.Client, bucketName)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("could not look up COSFirewallPolicy for bucket %s: %v", bucketName, err))
+	}
+	if policy == nil {
+		log.Info("no COSFirewallPolicy for bucket, skipping firewall reconfiguration", "bucket", bucketName)
+		return admission.Allowed("no COSFirewallPolicy")
+	}
+	switch policy.Spec.Mode {
+	case cosfirewallv1alpha1.FirewallModePodEgress, cosfirewallv1alpha1.FirewallModeMerged:
+		// The reconciler, not PV admission, owns the allow-list for these
+		// modes: it derives it from Pod egress IPs and keeps it in sync on
+		// every reconcile. Applying the secret's static allowed_ips here
+		// would race with and undo that, flapping the firewall.
+		log.Info("policy is not Static, leaving firewall to the reconciler", "bucket", bucketName, "mode", policy.Spec.Mode)
+		return admission.Allowed("")
+	}
+	enforced := policy.Spec.Enforce
+
+	if pv.Spec.FlexVolume.SecretRef == nil {
+		if enforced {
+			return admission.Denied(fmt.Sprintf("COSFirewallPolicy %s/%s enforces bucket %s, but the PV has no secretRef to verify against it", policy.Namespace, policy.Name, bucketName))
+		}
+		log.Info("secret not set, skipping firewall reconfiguration")
+		return admission.Allowed("no secretRef")
+	}
+	secretRef := pv.Spec.FlexVolume.SecretRef
+
+	pvSecret := &corev1.Secret{}
+	if err := m.Client.Get(ctx, apitypes.NamespacedName{Namespace: secretRef.Namespace, Name: secretRef.Name}, pvSecret); err != nil {
+		if enforced {
+			// Enforce is a hard guarantee: if we can't read the secret to
+			// check it against the policy, we must not let the PV through
+			// as if it had been checked.
+			return admission.Denied(fmt.Sprintf("COSFirewallPolicy %s/%s enforces bucket %s, but secret %s/%s is unreadable: %v", policy.Namespace, policy.Name, bucketName, secretRef.Namespace, secretRef.Name, err))
+		}
+		log.Error(err, "cannot retrieve secret for PV")
+		return admission.Allowed("secret lookup failed")
+	}
+
+	resConfApiKey := string(pvSecret.Data["res-conf-apikey"])
+	allowedIPs := string(pvSecret.Data["allowed_ips"])
+	if resConfApiKey == "" || allowedIPs == "" {
+		log.Info("res-conf-apikey or allowed_ips not set on secret")
+		return admission.Allowed("nothing to apply")
+	}
+
+	if enforced {
+		if missing := ipsNotIn(strings.Split(allowedIPs, ","), policy.Spec.AllowedIPs); len(missing) > 0 {
+			return admission.Denied(fmt.Sprintf("secret allowed_ips %v are not covered by COSFirewallPolicy %s/%s", missing, policy.Namespace, policy.Name))
+		}
+	}
+
+	if !policy.Status.Admitted {
+		// The validating webhook is what sets Admitted, and it runs after
+		// the mutating webhook in the admission chain - so the very first
+		// PV for a brand new policy always lands here. Leave the firewall
+		// write to the reconciler's next resync rather than pushing
+		// AllowedIPs to IBM COS on behalf of a policy nothing has vetted
+		// yet.
+		log.Info("policy not yet admitted, leaving firewall write to the reconciler", "bucket", bucketName)
+		return admission.Allowed("policy not yet admitted")
+	}
+
+	if err := ibmcos.UpdateFirewallRules(allowedIPs, resConfApiKey, bucketName); err != nil {
+		log.Error(err, "cannot configure firewall", "bucket", bucketName)
+	}
+
+	return admission.Allowed("")
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cosfirewallv1alpha1 "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/apis/cosfirewall/v1alpha1"
+)
+
+// TestPVSecurityMutatorHandle covers the paths that return before ever
+// reaching ibmcos.UpdateFirewallRules, so the test never makes a real IBM
+// COS API call. The admitted-and-applying path is not covered here; the
+// "not yet admitted" case below stops just before it.
+func TestPVSecurityMutatorHandle(t *testing.T) {
+	scheme := newTestScheme(t)
+	decoder := admission.NewDecoder(scheme)
+
+	s3fsPV := func(bucket, secretNS, secretName string) *corev1.PersistentVolume {
+		pv := &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					FlexVolume: &corev1.FlexPersistentVolumeSource{
+						Driver:  "ibm/ibmc-s3fs",
+						Options: map[string]string{"bucket": bucket},
+					},
+				},
+			},
+		}
+		if secretName != "" {
+			pv.Spec.FlexVolume.SecretRef = &corev1.SecretReference{Namespace: secretNS, Name: secretName}
+		}
+		return pv
+	}
+
+	widerSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-secret", Namespace: "ns"},
+		Data: map[string][]byte{
+			"res-conf-apikey": []byte("apikey"),
+			"allowed_ips":     []byte("1.1.1.1,9.9.9.9"),
+		},
+	}
+	coveredSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-secret", Namespace: "ns"},
+		Data: map[string][]byte{
+			"res-conf-apikey": []byte("apikey"),
+			"allowed_ips":     []byte("1.1.1.1,2.2.2.2"),
+		},
+	}
+	policy := func(enforce bool, mode cosfirewallv1alpha1.FirewallMode, admitted bool) *cosfirewallv1alpha1.COSFirewallPolicy {
+		return &cosfirewallv1alpha1.COSFirewallPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "policy-1", Namespace: "ns"},
+			Spec: cosfirewallv1alpha1.COSFirewallPolicySpec{
+				BucketName: "bucket-1",
+				AllowedIPs: []string{"1.1.1.1", "2.2.2.2"},
+				Enforce:    enforce,
+				Mode:       mode,
+			},
+			Status: cosfirewallv1alpha1.COSFirewallPolicyStatus{Admitted: admitted},
+		}
+	}
+
+	cases := []struct {
+		name        string
+		pv          *corev1.PersistentVolume
+		objects     []client.Object
+		wantAllowed bool
+	}{
+		{
+			name:        "not an ibmc-s3fs volume is allowed without a policy lookup",
+			pv:          &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-1"}},
+			wantAllowed: true,
+		},
+		{
+			name:        "no matching policy is allowed, firewall left untouched",
+			pv:          s3fsPV("bucket-1", "", ""),
+			wantAllowed: true,
+		},
+		{
+			name:        "PodEgress mode policy skips firewall reconfiguration",
+			pv:          s3fsPV("bucket-1", "", ""),
+			objects:     []client.Object{policy(false, cosfirewallv1alpha1.FirewallModePodEgress, true)},
+			wantAllowed: true,
+		},
+		{
+			name:        "no secretRef with enforce on is denied",
+			pv:          s3fsPV("bucket-1", "", ""),
+			objects:     []client.Object{policy(true, cosfirewallv1alpha1.FirewallModeStatic, true)},
+			wantAllowed: false,
+		},
+		{
+			name:        "no secretRef with enforce off is allowed",
+			pv:          s3fsPV("bucket-1", "", ""),
+			objects:     []client.Object{policy(false, cosfirewallv1alpha1.FirewallModeStatic, true)},
+			wantAllowed: true,
+		},
+		{
+			name:        "unreadable secret with enforce on fails closed",
+			pv:          s3fsPV("bucket-1", "ns", "missing-secret"),
+			objects:     []client.Object{policy(true, cosfirewallv1alpha1.FirewallModeStatic, true)},
+			wantAllowed: false,
+		},
+		{
+			name:        "enforced policy with wider secret allow-list is denied",
+			pv:          s3fsPV("bucket-1", "ns", "s3-secret"),
+			objects:     []client.Object{policy(true, cosfirewallv1alpha1.FirewallModeStatic, true), widerSecret},
+			wantAllowed: false,
+		},
+		{
+			name:        "not yet admitted policy skips the firewall write",
+			pv:          s3fsPV("bucket-1", "ns", "s3-secret"),
+			objects:     []client.Object{policy(false, cosfirewallv1alpha1.FirewallModeStatic, false), coveredSecret},
+			wantAllowed: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithStatusSubresource(&cosfirewallv1alpha1.COSFirewallPolicy{}).
+				WithObjects(tc.objects...).
+				Build()
+			m := NewPVSecurityMutator(c, decoder)
+
+			resp := m.Handle(context.Background(), newPVAdmissionRequest(t, tc.pv))
+			if resp.Allowed != tc.wantAllowed {
+				t.Fatalf("Handle().Allowed = %v, want %v (result: %+v)", resp.Allowed, tc.wantAllowed, resp.Result)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cosfirewallv1alpha1 "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/apis/cosfirewall/v1alpha1"
+	"github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/cosfirewallpolicy"
+)
+
+var pvValidationLog = logf.Log.WithName("pvvalidation")
+
+// PVSecurityValidator is the validating counterpart to PVSecurityMutator: it
+// rejects PV creation outright when the bucket has no matching
+// COSFirewallPolicy, or when enforcement is on and the policy's allow-list
+// does not cover what the PV's secret would otherwise apply. It is also the
+// only thing that sets COSFirewallPolicyStatus.Admitted, which
+// PVSecurityMutator and the reconciler both require before they will touch
+// the actual IBM COS bucket. This gives operators an auditable,
+// GitOps-friendly source of truth instead of relying on the mutating
+// webhook to silently reconfigure the firewall.
+type PVSecurityValidator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+// NewPVSecurityValidator builds a PVSecurityValidator bound to decoder.
+func NewPVSecurityValidator(c client.Client, decoder *admission.Decoder) *PVSecurityValidator {
+	return &PVSecurityValidator{Client: c, decoder: decoder}
+}
+
+// Handle implements admission.Handler.
+func (v *PVSecurityValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pv := &corev1.PersistentVolume{}
+	if err := v.decoder.Decode(req, pv); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if pv.Spec.FlexVolume == nil || !strings.Contains(pv.Spec.FlexVolume.Driver, "ibmc-s3fs") {
+		return admission.Allowed("not an ibmc-s3fs volume")
+	}
+
+	bucketName := pv.Spec.FlexVolume.Options["bucket"]
+	if bucketName == "" {
+		return admission.Denied("ibmc-s3fs PV has no bucket option set")
+	}
+
+	policy, err := cosfirewallpolicy.FindForBucket(ctx, v.Client, bucketName)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("could not look up COSFirewallPolicy for bucket %s: %v", bucketName, err))
+	}
+	if policy == nil {
+		return admission.Denied(fmt.Sprintf("no COSFirewallPolicy admits bucket %s; create one before provisioning this PV", bucketName))
+	}
+
+	if policy.Spec.Enforce && (policy.Spec.Mode == "" || policy.Spec.Mode == cosfirewallv1alpha1.FirewallModeStatic) && pv.Spec.FlexVolume.SecretRef != nil {
+		secretRef := pv.Spec.FlexVolume.SecretRef
+		pvSecret := &corev1.Secret{}
+		if err := v.Client.Get(ctx, apitypes.NamespacedName{Namespace: secretRef.Namespace, Name: secretRef.Name}, pvSecret); err != nil {
+			// Enforce is a hard guarantee: if we can't read the secret to
+			// check it against the policy, we must not let the PV through
+			// as if it had been checked.
+			return admission.Denied(fmt.Sprintf("cannot verify allowed_ips against COSFirewallPolicy %s/%s: secret %s/%s unreadable: %v", policy.Namespace, policy.Name, secretRef.Namespace, secretRef.Name, err))
+		} else if ips, ok := pvSecret.Data["allowed_ips"]; ok {
+			if missing := ipsNotIn(strings.Split(string(ips), ","), policy.Spec.AllowedIPs); len(missing) > 0 {
+				return admission.Denied(fmt.Sprintf("secret allowed_ips %v are not a subset of COSFirewallPolicy %s/%s allowedIPs", missing, policy.Namespace, policy.Name))
+			}
+		}
+	}
+
+	v.markAdmitted(ctx, policy)
+
+	return admission.Allowed("")
+}
+
+// markAdmitted records that policy has successfully validated at least one
+// PV admission, so Status.Admitted accurately reflects whether the policy
+// has ever been exercised rather than merely existing with a matching
+// bucketName. Failure to persist the status is logged but does not fail the
+// admission request; PVSecurityMutator and the reconciler then keep
+// treating the policy as not admitted until a later admission persists it.
+func (v *PVSecurityValidator) markAdmitted(ctx context.Context, policy *cosfirewallv1alpha1.COSFirewallPolicy) {
+	if policy.Status.Admitted {
+		return
+	}
+	policy.Status.Admitted = true
+	if err := v.Client.Status().Update(ctx, policy); err != nil {
+		pvValidationLog.Error(err, "unable to mark COSFirewallPolicy as admitted", "policy", apitypes.NamespacedName{Namespace: policy.Namespace, Name: policy.Name})
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cosfirewallv1alpha1 "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/apis/cosfirewall/v1alpha1"
+)
+
+func newPVAdmissionRequest(t *testing.T, pv *corev1.PersistentVolume) admission.Request {
+	t.Helper()
+	raw, err := json.Marshal(pv)
+	if err != nil {
+		t.Fatalf("marshal PV: %v", err)
+	}
+	return admission.Request{
+		AdmissionRequest: admissionv1Request(raw),
+	}
+}
+
+func TestPVSecurityValidatorHandle(t *testing.T) {
+	scheme := newTestScheme(t)
+	decoder := admission.NewDecoder(scheme)
+
+	s3fsPV := func(bucket, secretNS, secretName string) *corev1.PersistentVolume {
+		pv := &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					FlexVolume: &corev1.FlexPersistentVolumeSource{
+						Driver:  "ibm/ibmc-s3fs",
+						Options: map[string]string{"bucket": bucket},
+					},
+				},
+			},
+		}
+		if secretName != "" {
+			pv.Spec.FlexVolume.SecretRef = &corev1.SecretReference{Namespace: secretNS, Name: secretName}
+		}
+		return pv
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-secret", Namespace: "ns"},
+		Data: map[string][]byte{
+			"res-conf-apikey": []byte("apikey"),
+			"allowed_ips":     []byte("1.1.1.1,2.2.2.2"),
+		},
+	}
+	widerSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-secret", Namespace: "ns"},
+		Data: map[string][]byte{
+			"res-conf-apikey": []byte("apikey"),
+			"allowed_ips":     []byte("1.1.1.1,9.9.9.9"),
+		},
+	}
+	policy := func(enforce bool) *cosfirewallv1alpha1.COSFirewallPolicy {
+		return &cosfirewallv1alpha1.COSFirewallPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "policy-1", Namespace: "ns"},
+			Spec: cosfirewallv1alpha1.COSFirewallPolicySpec{
+				BucketName: "bucket-1",
+				AllowedIPs: []string{"1.1.1.1", "2.2.2.2"},
+				Enforce:    enforce,
+			},
+		}
+	}
+
+	cases := []struct {
+		name         string
+		pv           *corev1.PersistentVolume
+		objects      []client.Object
+		wantAllowed  bool
+		wantAdmitted bool
+	}{
+		{
+			name:        "not an ibmc-s3fs volume is allowed without a policy lookup",
+			pv:          &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-1"}},
+			wantAllowed: true,
+		},
+		{
+			name:        "missing bucket option is denied",
+			pv:          s3fsPV("", "", ""),
+			wantAllowed: false,
+		},
+		{
+			name:        "no matching policy is denied",
+			pv:          s3fsPV("bucket-1", "", ""),
+			wantAllowed: false,
+		},
+		{
+			name:         "matching non-enforced policy is allowed and admits the policy",
+			pv:           s3fsPV("bucket-1", "", ""),
+			objects:      []client.Object{policy(false)},
+			wantAllowed:  true,
+			wantAdmitted: true,
+		},
+		{
+			name:         "enforced policy with covered secret allow-list is allowed and admits the policy",
+			pv:           s3fsPV("bucket-1", "ns", "s3-secret"),
+			objects:      []client.Object{policy(true), secret},
+			wantAllowed:  true,
+			wantAdmitted: true,
+		},
+		{
+			name:        "enforced policy with wider secret allow-list is denied",
+			pv:          s3fsPV("bucket-1", "ns", "s3-secret"),
+			objects:     []client.Object{policy(true), widerSecret},
+			wantAllowed: false,
+		},
+		{
+			name:        "enforced policy with unreadable secret fails closed",
+			pv:          s3fsPV("bucket-1", "ns", "missing-secret"),
+			objects:     []client.Object{policy(true)},
+			wantAllowed: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithStatusSubresource(&cosfirewallv1alpha1.COSFirewallPolicy{}).
+				WithObjects(tc.objects...).
+				Build()
+			v := NewPVSecurityValidator(c, decoder)
+
+			resp := v.Handle(context.Background(), newPVAdmissionRequest(t, tc.pv))
+			if resp.Allowed != tc.wantAllowed {
+				t.Fatalf("Handle().Allowed = %v, want %v (result: %+v)", resp.Allowed, tc.wantAllowed, resp.Result)
+			}
+
+			if len(tc.objects) > 0 {
+				var got cosfirewallv1alpha1.COSFirewallPolicy
+				if err := c.Get(context.Background(), apitypes.NamespacedName{Namespace: "ns", Name: "policy-1"}, &got); err != nil {
+					t.Fatalf("Get policy: %v", err)
+				}
+				if got.Status.Admitted != tc.wantAdmitted {
+					t.Fatalf("policy Status.Admitted = %v, want %v", got.Status.Admitted, tc.wantAdmitted)
+				}
+			}
+		})
+	}
+}
+
+func TestPVSecurityValidatorMarkAdmittedIsIdempotent(t *testing.T) {
+	scheme := newTestScheme(t)
+	policy := &cosfirewallv1alpha1.COSFirewallPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy-1", Namespace: "ns"},
+		Spec:       cosfirewallv1alpha1.COSFirewallPolicySpec{BucketName: "bucket-1"},
+		Status:     cosfirewallv1alpha1.COSFirewallPolicyStatus{Admitted: true},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&cosfirewallv1alpha1.COSFirewallPolicy{}).
+		WithObjects(policy).
+		Build()
+	v := &PVSecurityValidator{Client: c}
+
+	v.markAdmitted(context.Background(), policy)
+
+	var got cosfirewallv1alpha1.COSFirewallPolicy
+	if err := c.Get(context.Background(), apitypes.NamespacedName{Namespace: "ns", Name: "policy-1"}, &got); err != nil {
+		t.Fatalf("Get policy: %v", err)
+	}
+	if !got.Status.Admitted {
+		t.Fatalf("policy Status.Admitted = false, want true")
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright (c) 2019,2020 StackRox Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	cosfirewallv1alpha1 "github.com/Bhagyashreek8/ibm-cos-firewall-webhook/pkg/apis/cosfirewall/v1alpha1"
+)
+
+// newTestScheme builds a scheme with the core and COSFirewallPolicy types
+// registered, enough for admission.NewDecoder and the fake client.
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme(corev1): %v", err)
+	}
+	if err := cosfirewallv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme(cosfirewallv1alpha1): %v", err)
+	}
+	return scheme
+}
+
+// admissionv1Request builds an AdmissionRequest carrying raw as the inline
+// object, as if the apiserver had sent it.
+func admissionv1Request(raw []byte) admissionv1.AdmissionRequest {
+	return admissionv1.AdmissionRequest{
+		Object: runtime.RawExtension{Raw: raw},
+	}
+}